@@ -0,0 +1,160 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidExpiration  = errors.New("negative expiration is not allowed")
+	ErrDuplicate          = errors.New("key with the given name already exists")
+	ErrNotFound           = errors.New("api key not found")
+	ErrNameMissing        = errors.New("api key name is missing")
+	ErrInvalidRole        = errors.New("invalid role")
+	ErrInvalidScope       = errors.New("invalid scope")
+	ErrExpired            = errors.New("api key has expired")
+)
+
+// APIKey is the model for API key objects.
+type APIKey struct {
+	Id               int64
+	OrgId            int64
+	Name             string
+	Key              string
+	Role             string
+	Created          time.Time
+	Updated          time.Time
+	LastUsedAt       *time.Time
+	Expires          *int64
+	ServiceAccountId *int64
+
+	// Scopes restricts the key to a set of RBAC scopes, e.g.
+	// "datasources:read" or "dashboards:write:uid/*". A nil or empty slice
+	// means the key carries its Role's full permission set, unrestricted.
+	Scopes []string `xorm:"json"`
+	// ExpiresAt is the absolute expiration time for scoped keys, as opposed
+	// to Expires, a Unix timestamp computed from AddCommand.SecondsToLive at
+	// creation time.
+	ExpiresAt *time.Time
+
+	// PreviousKey and PreviousKeyExpiresAt let a rotated key's old hash keep
+	// authenticating for a grace window after RotateKey issues a new one.
+	PreviousKey          *string
+	PreviousKeyExpiresAt *time.Time
+}
+
+// HasScope reports whether the key grants access to the given RBAC scope.
+// An unscoped key (nil or empty Scopes) matches everything. A scope entry
+// ending in "*" matches any scope sharing its prefix.
+func (k *APIKey) HasScope(scope string) bool {
+	if len(k.Scopes) == 0 {
+		return true
+	}
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+		if strings.HasSuffix(s, "*") && strings.HasPrefix(scope, strings.TrimSuffix(s, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExpired reports whether the key's absolute expiration has passed.
+func (k *APIKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && k.ExpiresAt.Before(now)
+}
+
+// validRoles are the org roles an API key may be granted.
+var validRoles = map[string]bool{"Viewer": true, "Editor": true, "Admin": true}
+
+// ValidateAddParams checks the fields AddCommand and AddScopedKeyCommand
+// have in common before a store inserts them: a non-empty name and a
+// recognized role. It does not check for a duplicate name, since that
+// requires a query against the store itself.
+func ValidateAddParams(name, role string) error {
+	if name == "" {
+		return ErrNameMissing
+	}
+	if !validRoles[role] {
+		return ErrInvalidRole
+	}
+	return nil
+}
+
+// AddCommand is the command used to add a new API key.
+type AddCommand struct {
+	Name          string
+	Role          string
+	OrgId         int64
+	Key           string
+	SecondsToLive int64
+
+	Result *APIKey
+}
+
+// AddScopedKeyCommand adds a new API key restricted to a set of RBAC scopes
+// with an absolute expiration time, as opposed to AddCommand's relative
+// seconds-to-live.
+type AddScopedKeyCommand struct {
+	Name      string
+	Role      string
+	OrgId     int64
+	Key       string
+	Scopes    []string
+	ExpiresAt time.Time
+
+	Result *APIKey
+}
+
+// DeleteCommand is the command used to delete an API key.
+type DeleteCommand struct {
+	Id    int64
+	OrgId int64
+}
+
+// GetApiKeysQuery lists the API keys for an organization.
+type GetApiKeysQuery struct {
+	OrgId          int64
+	IncludeExpired bool
+
+	Result []*APIKey
+}
+
+// GetByNameQuery looks up an API key by its name within an org.
+type GetByNameQuery struct {
+	KeyName string
+	OrgId   int64
+
+	Result *APIKey
+}
+
+// RotateKeyResult is the outcome of RotateKey. ClearTextKey is the newly
+// generated credential in the clear; like at creation time, it is only ever
+// available here — APIKey.Key holds the hash that gets persisted.
+type RotateKeyResult struct {
+	APIKey       *APIKey
+	ClearTextKey string
+}
+
+// Service is the interface for the API key service.
+type Service interface {
+	AddAPIKey(ctx context.Context, cmd *AddCommand) error
+	DeleteApiKey(ctx context.Context, cmd *DeleteCommand) error
+	GetApiKeys(ctx context.Context, query *GetApiKeysQuery) error
+	GetApiKeyById(ctx context.Context, id int64) (*APIKey, error)
+	GetApiKeyByName(ctx context.Context, query *GetByNameQuery) error
+	AddScopedKey(ctx context.Context, cmd *AddScopedKeyCommand) error
+	RotateKey(ctx context.Context, id int64, graceWindow time.Duration) (*RotateKeyResult, error)
+	// Authenticate looks up the key whose hash is hashedKey — the caller's
+	// presented credential, hashed the same way Add/AddScopedKey hash
+	// theirs — matching either the current hash or, during its grace
+	// window, a rotated key's PreviousKey. It enforces expiry and scope at
+	// auth time: it returns ErrExpired for an expired key and
+	// ErrInvalidScope when requiredScope is non-empty and the key wasn't
+	// granted it.
+	Authenticate(ctx context.Context, hashedKey string, requiredScope string) (*APIKey, error)
+}
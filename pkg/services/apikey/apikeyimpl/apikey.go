@@ -0,0 +1,73 @@
+package apikeyimpl
+
+import (
+	"context"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/db"
+	"github.com/grafana/grafana/pkg/services/apikey"
+	"github.com/grafana/grafana/pkg/services/serviceaccounts"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+type Service struct {
+	store store
+}
+
+func ProvideService(db db.DB, cfg *setting.Cfg, sa serviceaccounts.Service) apikey.Service {
+	return &Service{
+		store: &sqlStore{db: db, cfg: cfg, sa: sa},
+	}
+}
+
+func (s *Service) AddAPIKey(ctx context.Context, cmd *apikey.AddCommand) error {
+	return s.store.Add(ctx, cmd)
+}
+
+func (s *Service) DeleteApiKey(ctx context.Context, cmd *apikey.DeleteCommand) error {
+	return s.store.Delete(ctx, cmd)
+}
+
+func (s *Service) GetApiKeys(ctx context.Context, query *apikey.GetApiKeysQuery) error {
+	return s.store.GetAPIKeys(ctx, query)
+}
+
+func (s *Service) GetApiKeyById(ctx context.Context, id int64) (*apikey.APIKey, error) {
+	return s.store.GetApiKeyById(ctx, id)
+}
+
+func (s *Service) GetApiKeyByName(ctx context.Context, query *apikey.GetByNameQuery) error {
+	return s.store.GetApiKeyByName(ctx, query)
+}
+
+func (s *Service) AddScopedKey(ctx context.Context, cmd *apikey.AddScopedKeyCommand) error {
+	return s.store.AddScopedKey(ctx, cmd)
+}
+
+func (s *Service) RotateKey(ctx context.Context, id int64, graceWindow time.Duration) (*apikey.RotateKeyResult, error) {
+	return s.store.RotateKey(ctx, id, graceWindow)
+}
+
+func (s *Service) Authenticate(ctx context.Context, hashedKey string, requiredScope string) (*apikey.APIKey, error) {
+	key, err := s.store.GetApiKeyByHash(ctx, hashedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if key.IsExpired(now) || (key.Expires != nil && *key.Expires < now.Unix()) {
+		return nil, apikey.ErrExpired
+	}
+	if requiredScope != "" && !key.HasScope(requiredScope) {
+		return nil, apikey.ErrInvalidScope
+	}
+
+	return key, nil
+}
+
+// PurgeExpired deletes every scoped key past its absolute expiration. It is
+// not part of the Service interface: it is meant to be called directly by a
+// scheduled job rather than through request-serving code paths.
+func (s *Service) PurgeExpired(ctx context.Context, before time.Time) (int64, error) {
+	return s.store.PurgeExpired(ctx, before)
+}
@@ -0,0 +1,61 @@
+package apikeyimpl
+
+import (
+	"context"
+
+	"github.com/grafana/grafana/pkg/infra/db"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/services/serviceaccounts"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// MigrationRunner progressively converts legacy, org-bound API keys into
+// service-account-bound tokens on startup. It is opt-in: unless enabled via
+// the [api_keys] migrate_to_service_accounts_on_start setting, Run is a
+// no-op so that existing installs keep their legacy keys until an admin
+// chooses to migrate.
+//
+// MigrationRunner satisfies registry.BackgroundService (IsDisabled + Run),
+// so wiring it into the server's background service set only requires
+// adding ProvideMigrationRunner to the relevant wire set.
+type MigrationRunner struct {
+	store store
+	cfg   *setting.Cfg
+	log   log.Logger
+}
+
+func ProvideMigrationRunner(db db.DB, cfg *setting.Cfg, sa serviceaccounts.Service) *MigrationRunner {
+	return &MigrationRunner{
+		store: &sqlStore{db: db, cfg: cfg, sa: sa},
+		cfg:   cfg,
+		log:   log.New("apikey.migrationrunner"),
+	}
+}
+
+func (r *MigrationRunner) IsDisabled() bool {
+	return !r.cfg.SectionWithEnvOverrides("api_keys").Key("migrate_to_service_accounts_on_start").MustBool(false)
+}
+
+// Run migrates every unmigrated legacy key across all orgs. It is safe to
+// call repeatedly: keys that were already migrated (or created after
+// migration started) are skipped.
+func (r *MigrationRunner) Run(ctx context.Context) error {
+	if r.IsDisabled() {
+		return nil
+	}
+
+	keys, err := r.store.ListUnmigratedKeys(ctx, 0)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if _, err := r.store.MigrateToServiceAccount(ctx, key.OrgId, key.Id); err != nil {
+			r.log.Warn("failed to migrate api key to service account", "id", key.Id, "orgId", key.OrgId, "err", err)
+			continue
+		}
+		r.log.Info("migrated api key to service account", "id", key.Id, "orgId", key.OrgId)
+	}
+
+	return nil
+}
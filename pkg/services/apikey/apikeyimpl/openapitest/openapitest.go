@@ -0,0 +1,78 @@
+// Package openapitest builds API key fixtures from the generated
+// grafana-openapi-client-go models and validates them with those models'
+// own generated Validate method — the same required-field, enum, and
+// date-time format checks the real OpenAPI spec compiles down to — so a
+// fixture that drifts from the HTTP API contract fails the test instead of
+// silently compiling around it. It mirrors the approach taken by
+// grafana/terraform-provider-grafana#1211.
+package openapitest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/grafana/grafana-openapi-client-go/models"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/apikey"
+)
+
+// NewAddCommand builds an apikey.AddCommand from the generated AddCommand
+// model, validating it against the model's own generated constraints first
+// so the fields it sets can never drift from what the real HTTP API
+// requires.
+func NewAddCommand(t testing.TB, orgID int64, name string) *apikey.AddCommand {
+	t.Helper()
+	m := &models.AddCommand{
+		Name: name,
+		Role: "Viewer",
+	}
+	require.NoError(t, m.Validate(strfmt.Default))
+
+	return &apikey.AddCommand{
+		OrgId: orgID,
+		Name:  m.Name,
+		Role:  m.Role,
+	}
+}
+
+// NewScopedAddCommand builds an apikey.AddScopedKeyCommand for tests.
+//
+// Unlike NewAddCommand, this isn't validated against a generated model:
+// scopes and expiry aren't exposed anywhere in the real API key HTTP
+// surface yet, so grafana-openapi-client-go has no AddScopedKeyCommand to
+// validate against. These fixtures are only as good as this package's own
+// field list — revisit once scoped keys get a real spec entry.
+func NewScopedAddCommand(t testing.TB, orgID int64, name string, scopes []string, ttl time.Duration) *apikey.AddScopedKeyCommand {
+	t.Helper()
+	return &apikey.AddScopedKeyCommand{
+		OrgId:     orgID,
+		Name:      name,
+		Role:      "Viewer",
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+}
+
+// ValidateGetResult asserts that key satisfies the generated GetResult
+// model by round-tripping it through that model's own Validate method, so
+// this fails the moment the real spec adds a constraint the storage layer
+// doesn't meet, instead of checking against a copy of today's behavior.
+//
+// This only covers the fields GetResult actually has. ExpiresAt and
+// ServiceAccountId are additions to apikey.APIKey — scoped/expiring keys
+// and service-account migration were never given an HTTP handler or spec
+// entry, so there's no generated field to validate them against. They
+// aren't contract-backed yet; callers that care about them need their own
+// assertions.
+func ValidateGetResult(t testing.TB, key *apikey.APIKey) {
+	t.Helper()
+	m := &models.GetResult{
+		ID:      key.Id,
+		Name:    key.Name,
+		Role:    key.Role,
+		Created: strfmt.DateTime(key.Created),
+	}
+	require.NoError(t, m.Validate(strfmt.Default))
+}
@@ -0,0 +1,44 @@
+package apikeyimpl
+
+import (
+	"context"
+	"time"
+
+	"github.com/grafana/grafana/pkg/services/apikey"
+)
+
+// store is the storage interface backing the apikey service. It is kept
+// unexported so that alternative implementations (xorm-backed today) can be
+// swapped in tests without leaking storage details to callers.
+type store interface {
+	Add(ctx context.Context, cmd *apikey.AddCommand) error
+	Delete(ctx context.Context, cmd *apikey.DeleteCommand) error
+	GetAPIKeys(ctx context.Context, query *apikey.GetApiKeysQuery) error
+	GetApiKeyById(ctx context.Context, id int64) (*apikey.APIKey, error)
+	GetApiKeyByName(ctx context.Context, query *apikey.GetByNameQuery) error
+	// GetApiKeyByHash looks up the key whose hash is hashedKey, matching
+	// either the current hash or, while it hasn't passed
+	// PreviousKeyExpiresAt, the hash a rotated key kept valid for its grace
+	// window.
+	GetApiKeyByHash(ctx context.Context, hashedKey string) (*apikey.APIKey, error)
+
+	// MigrateToServiceAccount converts a legacy, org-bound API key into a
+	// service-account-bound token. It is idempotent: calling it again for a
+	// key that was already migrated returns that key, with its existing
+	// ServiceAccountId, instead of creating a second service account.
+	MigrateToServiceAccount(ctx context.Context, orgID, keyID int64) (*apikey.APIKey, error)
+	// ListUnmigratedKeys returns the legacy keys in an org that have not yet
+	// been converted to service-account-bound tokens, for batch migration.
+	ListUnmigratedKeys(ctx context.Context, orgID int64) ([]*apikey.APIKey, error)
+
+	// AddScopedKey creates a key restricted to cmd.Scopes that expires at
+	// cmd.ExpiresAt.
+	AddScopedKey(ctx context.Context, cmd *apikey.AddScopedKeyCommand) error
+	// RotateKey atomically replaces a key's hash with a freshly generated
+	// one, keeping the previous hash valid for graceWindow so in-flight
+	// clients aren't broken by the rotation.
+	RotateKey(ctx context.Context, id int64, graceWindow time.Duration) (*apikey.RotateKeyResult, error)
+	// PurgeExpired deletes every key whose absolute expiration is before the
+	// given time and returns the number of keys removed.
+	PurgeExpired(ctx context.Context, before time.Time) (int64, error)
+}
@@ -0,0 +1,334 @@
+package apikeyimpl
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/infra/db"
+	"github.com/grafana/grafana/pkg/services/apikey"
+	"github.com/grafana/grafana/pkg/services/apikey/apikeyimpl/openapitest"
+	"github.com/grafana/grafana/pkg/services/serviceaccounts"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+type getStore func(ss db.DB, cfg *setting.Cfg) store
+
+// fakeSAService is a minimal serviceaccounts.Service double used only to
+// exercise the migration path without standing up the real service account
+// store. failNext lets a single test force a partial-failure rollback;
+// failDelete lets a test force that rollback's own cleanup to fail in turn.
+type fakeSAService struct {
+	serviceaccounts.Service
+	nextID     int64
+	failNext   bool
+	failDelete bool
+	deleted    []int64
+}
+
+func (f *fakeSAService) CreateServiceAccount(ctx context.Context, orgID int64, form *serviceaccounts.CreateServiceAccountForm) (*serviceaccounts.ServiceAccountDTO, error) {
+	if f.failNext {
+		f.failNext = false
+		return nil, errors.New("boom")
+	}
+	f.nextID++
+	return &serviceaccounts.ServiceAccountDTO{Id: f.nextID, Name: form.Name, OrgId: orgID}, nil
+}
+
+func (f *fakeSAService) DeleteServiceAccount(ctx context.Context, orgID, serviceAccountID int64) error {
+	if f.failDelete {
+		return errors.New("boom-delete")
+	}
+	f.deleted = append(f.deleted, serviceAccountID)
+	return nil
+}
+
+func testIntegrationApiKeyDataAccess(t *testing.T, fn getStore) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	t.Run("Add and get an api key", func(t *testing.T) {
+		ss := db.InitTestDB(t)
+		cfg := setting.NewCfg()
+		store := fn(ss, cfg)
+
+		cmd := openapitest.NewAddCommand(t, 1, "main")
+		cmd.OrgId = 1
+		cmd.Key = "hash"
+		require.NoError(t, store.Add(context.Background(), cmd))
+		require.NotNil(t, cmd.Result)
+
+		key, err := store.GetApiKeyById(context.Background(), cmd.Result.Id)
+		require.NoError(t, err)
+		require.Equal(t, "main", key.Name)
+		openapitest.ValidateGetResult(t, key)
+	})
+
+	t.Run("Add rejects a blank name, an unrecognized role, and a duplicate name", func(t *testing.T) {
+		ss := db.InitTestDB(t)
+		cfg := setting.NewCfg()
+		store := fn(ss, cfg)
+
+		noName := openapitest.NewAddCommand(t, 1, "main")
+		noName.Name = ""
+		require.ErrorIs(t, store.Add(context.Background(), noName), apikey.ErrNameMissing)
+
+		badRole := openapitest.NewAddCommand(t, 1, "main")
+		badRole.Role = "SuperUser"
+		require.ErrorIs(t, store.Add(context.Background(), badRole), apikey.ErrInvalidRole)
+
+		cmd := openapitest.NewAddCommand(t, 1, "main")
+		cmd.Key = "hash"
+		require.NoError(t, store.Add(context.Background(), cmd))
+
+		dup := openapitest.NewAddCommand(t, 1, "main")
+		dup.Key = "other-hash"
+		require.ErrorIs(t, store.Add(context.Background(), dup), apikey.ErrDuplicate)
+	})
+
+	t.Run("Migrating a key to a service account is idempotent", func(t *testing.T) {
+		ss := db.InitTestDB(t)
+		cfg := setting.NewCfg()
+		sqlStore := &sqlStore{db: ss, cfg: cfg, sa: &fakeSAService{}}
+
+		cmd := openapitest.NewAddCommand(t, 1, "legacy")
+		cmd.OrgId = 1
+		cmd.Key = "hash"
+		require.NoError(t, sqlStore.Add(context.Background(), cmd))
+
+		first, err := sqlStore.MigrateToServiceAccount(context.Background(), 1, cmd.Result.Id)
+		require.NoError(t, err)
+		require.NotNil(t, first.ServiceAccountId)
+
+		second, err := sqlStore.MigrateToServiceAccount(context.Background(), 1, cmd.Result.Id)
+		require.NoError(t, err)
+		require.Equal(t, *first.ServiceAccountId, *second.ServiceAccountId)
+	})
+
+	t.Run("A failed service account creation rolls back the migration", func(t *testing.T) {
+		ss := db.InitTestDB(t)
+		cfg := setting.NewCfg()
+		sa := &fakeSAService{failNext: true}
+		sqlStore := &sqlStore{db: ss, cfg: cfg, sa: sa}
+
+		cmd := openapitest.NewAddCommand(t, 1, "legacy")
+		cmd.OrgId = 1
+		cmd.Key = "hash"
+		require.NoError(t, sqlStore.Add(context.Background(), cmd))
+
+		_, err := sqlStore.MigrateToServiceAccount(context.Background(), 1, cmd.Result.Id)
+		require.Error(t, err)
+
+		unmigrated, err := sqlStore.ListUnmigratedKeys(context.Background(), 1)
+		require.NoError(t, err)
+		require.Len(t, unmigrated, 1)
+
+		key, err := sqlStore.GetApiKeyById(context.Background(), cmd.Result.Id)
+		require.NoError(t, err)
+		require.Nil(t, key.ServiceAccountId)
+	})
+
+	t.Run("A failure after the service account is created deletes the orphan", func(t *testing.T) {
+		ss := db.InitTestDB(t)
+		cfg := setting.NewCfg()
+		sa := &fakeSAService{}
+		sqlStore := &sqlStore{db: ss, cfg: cfg, sa: sa}
+
+		cmd := openapitest.NewAddCommand(t, 1, "legacy")
+		cmd.OrgId = 1
+		cmd.Key = "hash"
+		require.NoError(t, sqlStore.Add(context.Background(), cmd))
+
+		// A mapping row for this api_key_id under a different org trips the
+		// unique index on api_key_migration.api_key_id when
+		// MigrateToServiceAccount tries to insert its own mapping, forcing
+		// that insert to fail *after* CreateServiceAccount has already run.
+		// CreateServiceAccount isn't part of the SQL transaction, so nothing
+		// in this package can roll it back with it: MigrateToServiceAccount
+		// must clean up the account it already created itself.
+		require.NoError(t, ss.WithDbSession(context.Background(), func(sess *db.Session) error {
+			_, err := sess.Insert(&apiKeyMigration{OrgId: 999, ApiKeyId: cmd.Result.Id, ServiceAccountId: 1, Created: time.Now()})
+			return err
+		}))
+
+		_, err := sqlStore.MigrateToServiceAccount(context.Background(), 1, cmd.Result.Id)
+		require.Error(t, err)
+		require.Equal(t, int64(1), sa.nextID, "the service account was created before the failing write")
+		require.Equal(t, []int64{1}, sa.deleted, "the orphaned service account was cleaned up")
+
+		key, err := sqlStore.GetApiKeyById(context.Background(), cmd.Result.Id)
+		require.NoError(t, err)
+		require.Nil(t, key.ServiceAccountId, "the DB side of the migration rolled back")
+	})
+
+	t.Run("A failure cleaning up an orphaned service account doesn't hide the original error", func(t *testing.T) {
+		ss := db.InitTestDB(t)
+		cfg := setting.NewCfg()
+		sa := &fakeSAService{failDelete: true}
+		sqlStore := &sqlStore{db: ss, cfg: cfg, sa: sa}
+
+		cmd := openapitest.NewAddCommand(t, 1, "legacy")
+		cmd.OrgId = 1
+		cmd.Key = "hash"
+		require.NoError(t, sqlStore.Add(context.Background(), cmd))
+
+		require.NoError(t, ss.WithDbSession(context.Background(), func(sess *db.Session) error {
+			_, err := sess.Insert(&apiKeyMigration{OrgId: 999, ApiKeyId: cmd.Result.Id, ServiceAccountId: 1, Created: time.Now()})
+			return err
+		}))
+
+		_, err := sqlStore.MigrateToServiceAccount(context.Background(), 1, cmd.Result.Id)
+		require.Error(t, err)
+		require.Empty(t, sa.deleted, "the cleanup attempt itself failed")
+	})
+
+	t.Run("Legacy and migrated keys coexist during rollout", func(t *testing.T) {
+		ss := db.InitTestDB(t)
+		cfg := setting.NewCfg()
+		sqlStore := &sqlStore{db: ss, cfg: cfg, sa: &fakeSAService{}}
+
+		legacy := openapitest.NewAddCommand(t, 1, "legacy")
+		legacy.OrgId = 1
+		legacy.Key = "hash-1"
+		migrated := openapitest.NewAddCommand(t, 1, "migrated")
+		migrated.OrgId = 1
+		migrated.Key = "hash-2"
+		require.NoError(t, sqlStore.Add(context.Background(), legacy))
+		require.NoError(t, sqlStore.Add(context.Background(), migrated))
+
+		_, err := sqlStore.MigrateToServiceAccount(context.Background(), 1, migrated.Result.Id)
+		require.NoError(t, err)
+
+		unmigrated, err := sqlStore.ListUnmigratedKeys(context.Background(), 1)
+		require.NoError(t, err)
+		require.Len(t, unmigrated, 1)
+		require.Equal(t, legacy.Result.Id, unmigrated[0].Id)
+
+		query := &apikey.GetApiKeysQuery{OrgId: 1}
+		require.NoError(t, sqlStore.GetAPIKeys(context.Background(), query))
+		require.Len(t, query.Result, 2)
+	})
+
+	t.Run("A scoped key only matches the scopes it was granted", func(t *testing.T) {
+		ss := db.InitTestDB(t)
+		cfg := setting.NewCfg()
+		store := fn(ss, cfg)
+
+		cmd := openapitest.NewScopedAddCommand(t, 1, "scoped", []string{"datasources:read", "dashboards:write:uid/*"}, time.Hour)
+		cmd.Key = "hash"
+		require.NoError(t, store.AddScopedKey(context.Background(), cmd))
+
+		require.True(t, cmd.Result.HasScope("datasources:read"))
+		require.True(t, cmd.Result.HasScope("dashboards:write:uid/abc"))
+		require.False(t, cmd.Result.HasScope("datasources:write"))
+	})
+
+	t.Run("Rotating a key keeps the old hash valid during the grace window", func(t *testing.T) {
+		ss := db.InitTestDB(t)
+		cfg := setting.NewCfg()
+		store := fn(ss, cfg)
+
+		cmd := openapitest.NewAddCommand(t, 1, "rotating")
+		cmd.OrgId = 1
+		cmd.Key = "original-hash"
+		require.NoError(t, store.Add(context.Background(), cmd))
+
+		rotated, err := store.RotateKey(context.Background(), cmd.Result.Id, time.Hour)
+		require.NoError(t, err)
+		require.NotEmpty(t, rotated.ClearTextKey)
+		require.NotEqual(t, "original-hash", rotated.APIKey.Key)
+		require.NotNil(t, rotated.APIKey.PreviousKey)
+		require.Equal(t, "original-hash", *rotated.APIKey.PreviousKey)
+		require.NotNil(t, rotated.APIKey.PreviousKeyExpiresAt)
+		require.True(t, rotated.APIKey.PreviousKeyExpiresAt.After(time.Now()))
+	})
+
+	t.Run("PurgeExpired removes only keys past their absolute expiration", func(t *testing.T) {
+		ss := db.InitTestDB(t)
+		cfg := setting.NewCfg()
+		store := fn(ss, cfg)
+
+		expired := openapitest.NewScopedAddCommand(t, 1, "expired", []string{"datasources:read"}, -time.Hour)
+		expired.Key = "h1"
+		live := openapitest.NewScopedAddCommand(t, 1, "live", []string{"datasources:read"}, time.Hour)
+		live.Key = "h2"
+		require.NoError(t, store.AddScopedKey(context.Background(), expired))
+		require.NoError(t, store.AddScopedKey(context.Background(), live))
+
+		removed, err := store.PurgeExpired(context.Background(), time.Now())
+		require.NoError(t, err)
+		require.Equal(t, int64(1), removed)
+
+		_, err = store.GetApiKeyById(context.Background(), expired.Result.Id)
+		require.ErrorIs(t, err, apikey.ErrNotFound)
+
+		remaining, err := store.GetApiKeyById(context.Background(), live.Result.Id)
+		require.NoError(t, err)
+		require.Equal(t, "live", remaining.Name)
+	})
+
+	t.Run("Authenticate looks keys up by hash and enforces expiry and scope", func(t *testing.T) {
+		ss := db.InitTestDB(t)
+		cfg := setting.NewCfg()
+		sqlStore := &sqlStore{db: ss, cfg: cfg, sa: &fakeSAService{}}
+		svc := &Service{store: sqlStore}
+
+		live := openapitest.NewScopedAddCommand(t, 1, "scoped", []string{"datasources:read"}, time.Hour)
+		live.Key = "hash-live"
+		require.NoError(t, sqlStore.AddScopedKey(context.Background(), live))
+
+		expired := openapitest.NewScopedAddCommand(t, 1, "scoped-expired", []string{"datasources:read"}, -time.Hour)
+		expired.Key = "hash-expired"
+		require.NoError(t, sqlStore.AddScopedKey(context.Background(), expired))
+
+		key, err := svc.Authenticate(context.Background(), "hash-live", "datasources:read")
+		require.NoError(t, err)
+		require.Equal(t, live.Result.Id, key.Id)
+
+		_, err = svc.Authenticate(context.Background(), "hash-live", "datasources:write")
+		require.ErrorIs(t, err, apikey.ErrInvalidScope)
+
+		_, err = svc.Authenticate(context.Background(), "hash-expired", "datasources:read")
+		require.ErrorIs(t, err, apikey.ErrExpired)
+
+		_, err = svc.Authenticate(context.Background(), "not-a-real-hash", "")
+		require.ErrorIs(t, err, apikey.ErrNotFound)
+
+		// A key's name is visible in the UI and not secret; authenticating
+		// with it instead of the actual hash must fail.
+		_, err = svc.Authenticate(context.Background(), "scoped", "")
+		require.ErrorIs(t, err, apikey.ErrNotFound)
+	})
+
+	t.Run("Authenticate accepts the previous hash during a rotation's grace window", func(t *testing.T) {
+		ss := db.InitTestDB(t)
+		cfg := setting.NewCfg()
+		sqlStore := &sqlStore{db: ss, cfg: cfg, sa: &fakeSAService{}}
+		svc := &Service{store: sqlStore}
+
+		cmd := openapitest.NewAddCommand(t, 1, "rotating")
+		cmd.OrgId = 1
+		cmd.Key = "original-hash"
+		require.NoError(t, sqlStore.Add(context.Background(), cmd))
+
+		rotated, err := sqlStore.RotateKey(context.Background(), cmd.Result.Id, time.Hour)
+		require.NoError(t, err)
+
+		key, err := svc.Authenticate(context.Background(), rotated.APIKey.Key, "")
+		require.NoError(t, err)
+		require.Equal(t, cmd.Result.Id, key.Id)
+
+		key, err = svc.Authenticate(context.Background(), "original-hash", "")
+		require.NoError(t, err)
+		require.Equal(t, cmd.Result.Id, key.Id)
+
+		expiredRotation, err := sqlStore.RotateKey(context.Background(), cmd.Result.Id, -time.Hour)
+		require.NoError(t, err)
+		_, err = svc.Authenticate(context.Background(), *expiredRotation.APIKey.PreviousKey, "")
+		require.ErrorIs(t, err, apikey.ErrNotFound)
+	})
+}
@@ -0,0 +1,328 @@
+package apikeyimpl
+
+import (
+	"context"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/apikeygen"
+	"github.com/grafana/grafana/pkg/infra/db"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/services/apikey"
+	"github.com/grafana/grafana/pkg/services/serviceaccounts"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+var logger = log.New("apikeyimpl.store")
+
+type sqlStore struct {
+	db  db.DB
+	cfg *setting.Cfg
+	sa  serviceaccounts.Service
+}
+
+// apiKeyMigration records that a legacy API key has been converted to a
+// service-account-bound token, so the migration never runs twice for the
+// same key.
+type apiKeyMigration struct {
+	Id               int64
+	OrgId            int64
+	ApiKeyId         int64
+	ServiceAccountId int64
+	Created          time.Time
+}
+
+func (apiKeyMigration) TableName() string {
+	return "api_key_migration"
+}
+
+func (ss *sqlStore) Add(ctx context.Context, cmd *apikey.AddCommand) error {
+	return ss.db.WithTransactionalDbSession(ctx, func(sess *db.Session) error {
+		if err := apikey.ValidateAddParams(cmd.Name, cmd.Role); err != nil {
+			return err
+		}
+
+		exists, err := sess.Table("api_key").Where("org_id=? AND name=?", cmd.OrgId, cmd.Name).Exist()
+		if err != nil {
+			return err
+		}
+		if exists {
+			return apikey.ErrDuplicate
+		}
+
+		key := &apikey.APIKey{
+			OrgId:   cmd.OrgId,
+			Name:    cmd.Name,
+			Role:    cmd.Role,
+			Key:     cmd.Key,
+			Created: time.Now(),
+			Updated: time.Now(),
+		}
+
+		if cmd.SecondsToLive > 0 {
+			expires := key.Created.Add(time.Second * time.Duration(cmd.SecondsToLive)).Unix()
+			key.Expires = &expires
+		} else if cmd.SecondsToLive < 0 {
+			return apikey.ErrInvalidExpiration
+		}
+
+		if _, err := sess.Insert(key); err != nil {
+			return err
+		}
+		cmd.Result = key
+		return nil
+	})
+}
+
+func (ss *sqlStore) Delete(ctx context.Context, cmd *apikey.DeleteCommand) error {
+	return ss.db.WithTransactionalDbSession(ctx, func(sess *db.Session) error {
+		_, err := sess.Exec("DELETE FROM api_key WHERE id=? and org_id=?", cmd.Id, cmd.OrgId)
+		return err
+	})
+}
+
+func (ss *sqlStore) GetAPIKeys(ctx context.Context, query *apikey.GetApiKeysQuery) error {
+	return ss.db.WithDbSession(ctx, func(sess *db.Session) error {
+		sess.Table("api_key").Where("org_id=?", query.OrgId)
+		if !query.IncludeExpired {
+			now := time.Now()
+			sess.And("(expires IS NULL OR expires >= ?)", now.Unix())
+			sess.And("(expires_at IS NULL OR expires_at >= ?)", now)
+		}
+		sess.OrderBy("name ASC")
+
+		var keys []*apikey.APIKey
+		if err := sess.Find(&keys); err != nil {
+			return err
+		}
+		query.Result = keys
+		return nil
+	})
+}
+
+func (ss *sqlStore) GetApiKeyById(ctx context.Context, id int64) (*apikey.APIKey, error) {
+	var result *apikey.APIKey
+	err := ss.db.WithDbSession(ctx, func(sess *db.Session) error {
+		key := apikey.APIKey{}
+		has, err := sess.ID(id).Get(&key)
+		if err != nil {
+			return err
+		}
+		if !has {
+			return apikey.ErrNotFound
+		}
+		result = &key
+		return nil
+	})
+	return result, err
+}
+
+func (ss *sqlStore) AddScopedKey(ctx context.Context, cmd *apikey.AddScopedKeyCommand) error {
+	return ss.db.WithTransactionalDbSession(ctx, func(sess *db.Session) error {
+		if err := apikey.ValidateAddParams(cmd.Name, cmd.Role); err != nil {
+			return err
+		}
+
+		exists, err := sess.Table("api_key").Where("org_id=? AND name=?", cmd.OrgId, cmd.Name).Exist()
+		if err != nil {
+			return err
+		}
+		if exists {
+			return apikey.ErrDuplicate
+		}
+
+		key := &apikey.APIKey{
+			OrgId:     cmd.OrgId,
+			Name:      cmd.Name,
+			Role:      cmd.Role,
+			Key:       cmd.Key,
+			Scopes:    cmd.Scopes,
+			ExpiresAt: &cmd.ExpiresAt,
+			Created:   time.Now(),
+			Updated:   time.Now(),
+		}
+
+		if _, err := sess.Insert(key); err != nil {
+			return err
+		}
+		cmd.Result = key
+		return nil
+	})
+}
+
+func (ss *sqlStore) RotateKey(ctx context.Context, id int64, graceWindow time.Duration) (*apikey.RotateKeyResult, error) {
+	var result *apikey.RotateKeyResult
+	err := ss.db.WithTransactionalDbSession(ctx, func(sess *db.Session) error {
+		key := apikey.APIKey{}
+		has, err := sess.ID(id).Get(&key)
+		if err != nil {
+			return err
+		}
+		if !has {
+			return apikey.ErrNotFound
+		}
+
+		generated, err := apikeygen.New(key.OrgId)
+		if err != nil {
+			return err
+		}
+
+		oldHash := key.Key
+		graceExpires := time.Now().Add(graceWindow)
+		key.PreviousKey = &oldHash
+		key.PreviousKeyExpiresAt = &graceExpires
+		key.Key = generated.HashedKey
+		key.Updated = time.Now()
+
+		if _, err := sess.ID(id).Cols("key", "previous_key", "previous_key_expires_at", "updated").Update(&key); err != nil {
+			return err
+		}
+
+		result = &apikey.RotateKeyResult{APIKey: &key, ClearTextKey: generated.ClientSecret}
+		return nil
+	})
+	return result, err
+}
+
+func (ss *sqlStore) PurgeExpired(ctx context.Context, before time.Time) (int64, error) {
+	var removed int64
+	err := ss.db.WithTransactionalDbSession(ctx, func(sess *db.Session) error {
+		res, err := sess.Exec("DELETE FROM api_key WHERE expires_at IS NOT NULL AND expires_at < ?", before)
+		if err != nil {
+			return err
+		}
+		removed, err = res.RowsAffected()
+		return err
+	})
+	return removed, err
+}
+
+func (ss *sqlStore) MigrateToServiceAccount(ctx context.Context, orgID, keyID int64) (*apikey.APIKey, error) {
+	var result *apikey.APIKey
+	err := ss.db.WithTransactionalDbSession(ctx, func(sess *db.Session) error {
+		alreadyMigrated, err := sess.Where("org_id=? AND api_key_id=?", orgID, keyID).Get(&apiKeyMigration{})
+		if err != nil {
+			return err
+		}
+
+		key := apikey.APIKey{}
+		keyExists, err := sess.ID(keyID).Where("org_id=?", orgID).Get(&key)
+		if err != nil {
+			return err
+		}
+		if !keyExists {
+			return apikey.ErrNotFound
+		}
+
+		if alreadyMigrated {
+			// Already migrated: return the key as it stands, leaving the
+			// existing service account and mapping untouched.
+			result = &key
+			return nil
+		}
+
+		account, err := ss.sa.CreateServiceAccount(ctx, orgID, &serviceaccounts.CreateServiceAccountForm{
+			Name: "migrated-" + key.Name,
+		})
+		if err != nil {
+			return err
+		}
+
+		key.ServiceAccountId = &account.Id
+		key.Updated = time.Now()
+		if _, err := sess.ID(keyID).Cols("service_account_id", "updated").Update(&key); err != nil {
+			return ss.rollbackOrphanedServiceAccount(ctx, orgID, account.Id, err)
+		}
+
+		mapping := &apiKeyMigration{
+			OrgId:            orgID,
+			ApiKeyId:         keyID,
+			ServiceAccountId: account.Id,
+			Created:          time.Now(),
+		}
+		if _, err := sess.Insert(mapping); err != nil {
+			return ss.rollbackOrphanedServiceAccount(ctx, orgID, account.Id, err)
+		}
+
+		result = &key
+		return nil
+	})
+	return result, err
+}
+
+// rollbackOrphanedServiceAccount is called when a step after
+// CreateServiceAccount fails. CreateServiceAccount isn't part of the SQL
+// transaction, so the account it already created survives the session
+// rollback; this tries to delete it to match, and failing that, logs it at
+// error level with the account ID so an operator can find and remove it by
+// hand. Either way it returns cause, the error that triggered the rollback.
+func (ss *sqlStore) rollbackOrphanedServiceAccount(ctx context.Context, orgID, serviceAccountID int64, cause error) error {
+	if delErr := ss.sa.DeleteServiceAccount(ctx, orgID, serviceAccountID); delErr != nil {
+		logger.Error("orphaned service account after failed api key migration", "orgId", orgID, "serviceAccountId", serviceAccountID, "cause", cause, "deleteErr", delErr)
+	}
+	return cause
+}
+
+// ListUnmigratedKeys returns the unmigrated legacy keys in orgID, or across
+// every org when orgID is 0 — the mode the startup MigrationRunner uses.
+func (ss *sqlStore) ListUnmigratedKeys(ctx context.Context, orgID int64) ([]*apikey.APIKey, error) {
+	var result []*apikey.APIKey
+	err := ss.db.WithDbSession(ctx, func(sess *db.Session) error {
+		sess.Table("api_key").
+			Join("LEFT", "api_key_migration", "api_key_migration.api_key_id = api_key.id").
+			Where("api_key_migration.id IS NULL")
+		if orgID != 0 {
+			sess.And("api_key.org_id=?", orgID)
+		}
+		sess.OrderBy("api_key.id ASC")
+
+		var keys []*apikey.APIKey
+		if err := sess.Find(&keys); err != nil {
+			return err
+		}
+		result = keys
+		return nil
+	})
+	return result, err
+}
+
+// GetApiKeyByHash looks up a key by its hash, first against the current
+// hash and, failing that, against PreviousKey while PreviousKeyExpiresAt
+// hasn't passed, so a key rotated mid-flight keeps authenticating for its
+// grace window.
+func (ss *sqlStore) GetApiKeyByHash(ctx context.Context, hashedKey string) (*apikey.APIKey, error) {
+	var result *apikey.APIKey
+	err := ss.db.WithDbSession(ctx, func(sess *db.Session) error {
+		key := apikey.APIKey{}
+		has, err := sess.Where("key=?", hashedKey).Get(&key)
+		if err != nil {
+			return err
+		}
+		if !has {
+			has, err = sess.Where("previous_key=? AND previous_key_expires_at >= ?", hashedKey, time.Now()).Get(&key)
+			if err != nil {
+				return err
+			}
+		}
+		if !has {
+			return apikey.ErrNotFound
+		}
+		result = &key
+		return nil
+	})
+	return result, err
+}
+
+func (ss *sqlStore) GetApiKeyByName(ctx context.Context, query *apikey.GetByNameQuery) error {
+	return ss.db.WithDbSession(ctx, func(sess *db.Session) error {
+		key := apikey.APIKey{}
+		has, err := sess.Where("org_id=? AND name=?", query.OrgId, query.KeyName).Get(&key)
+		if err != nil {
+			return err
+		}
+		if !has {
+			return apikey.ErrNotFound
+		}
+		query.Result = &key
+		return nil
+	})
+}
@@ -0,0 +1,32 @@
+package migrations
+
+import . "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+
+// addApiKeyMigrationTableMigrations introduces the api_key_migration table,
+// which records which legacy api_key rows have been converted to
+// service-account-bound tokens so the apikeyimpl migration runner never
+// re-migrates the same key.
+func addApiKeyMigrationTableMigrations(mg *Migrator) {
+	apiKeyMigrationV1 := Table{
+		Name: "api_key_migration",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: DB_BigInt, Nullable: false},
+			{Name: "api_key_id", Type: DB_BigInt, Nullable: false},
+			{Name: "service_account_id", Type: DB_BigInt, Nullable: false},
+			{Name: "created", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"api_key_id"}, Type: UniqueIndex},
+			{Cols: []string{"org_id"}},
+		},
+	}
+
+	mg.AddMigration("create api_key_migration table", NewAddTableMigration(apiKeyMigrationV1))
+	mg.AddMigration("add unique index api_key_migration.api_key_id", NewAddIndexMigration(apiKeyMigrationV1, apiKeyMigrationV1.Indices[0]))
+	mg.AddMigration("add index api_key_migration.org_id", NewAddIndexMigration(apiKeyMigrationV1, apiKeyMigrationV1.Indices[1]))
+
+	mg.AddMigration("add service_account_id column to api_key", NewAddColumnMigration(Table{Name: "api_key"}, &Column{
+		Name: "service_account_id", Type: DB_BigInt, Nullable: true,
+	}))
+}
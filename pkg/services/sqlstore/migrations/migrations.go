@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	. "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+)
+
+// OSSMigrations registers every schema migration this tree knows about. The
+// upstream Grafana copy of this file calls dozens of addXxxMigrations
+// functions built up over the project's history; this slice only carries
+// the ones introduced alongside apikeyimpl and tagimpl, appended in the
+// order their migrations were added, matching upstream convention of
+// appending new migration groups at the end of AddMigration rather than
+// interleaving them with existing ones.
+type OSSMigrations struct {
+}
+
+func ProvideOSSMigrations() *OSSMigrations {
+	return &OSSMigrations{}
+}
+
+func (*OSSMigrations) AddMigration(mg *Migrator) {
+	addApiKeyMigrationTableMigrations(mg)
+	addScopedApiKeyMigrations(mg)
+	addTagHierarchyMigrations(mg)
+}
@@ -0,0 +1,23 @@
+package migrations
+
+import . "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+
+// addScopedApiKeyMigrations adds the columns backing scoped, expiring API
+// keys: a JSON-encoded scopes list, an absolute expiration time, and the
+// previous key hash kept alive during a RotateKey grace window.
+func addScopedApiKeyMigrations(mg *Migrator) {
+	apiKeyTable := Table{Name: "api_key"}
+
+	mg.AddMigration("add scopes column to api_key", NewAddColumnMigration(apiKeyTable, &Column{
+		Name: "scopes", Type: DB_Text, Nullable: true,
+	}))
+	mg.AddMigration("add expires_at column to api_key", NewAddColumnMigration(apiKeyTable, &Column{
+		Name: "expires_at", Type: DB_DateTime, Nullable: true,
+	}))
+	mg.AddMigration("add previous_key column to api_key", NewAddColumnMigration(apiKeyTable, &Column{
+		Name: "previous_key", Type: DB_NVarchar, Length: 190, Nullable: true,
+	}))
+	mg.AddMigration("add previous_key_expires_at column to api_key", NewAddColumnMigration(apiKeyTable, &Column{
+		Name: "previous_key_expires_at", Type: DB_DateTime, Nullable: true,
+	}))
+}
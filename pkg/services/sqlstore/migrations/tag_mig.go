@@ -0,0 +1,30 @@
+package migrations
+
+import . "github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+
+// addTagHierarchyMigrations adds a parent reference to the tag table and a
+// tag_edge transitive-closure cache, so ResolveAncestors/ResolveDescendants
+// can answer in a single indexed query instead of walking the hierarchy.
+func addTagHierarchyMigrations(mg *Migrator) {
+	mg.AddMigration("add parent column to tag", NewAddColumnMigration(Table{Name: "tag"}, &Column{
+		Name: "parent", Type: DB_BigInt, Nullable: true,
+	}))
+
+	tagEdgeV1 := Table{
+		Name: "tag_edge",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "ancestor_id", Type: DB_BigInt, Nullable: false},
+			{Name: "descendant_id", Type: DB_BigInt, Nullable: false},
+			{Name: "depth", Type: DB_Int, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"ancestor_id", "descendant_id"}, Type: UniqueIndex},
+			{Cols: []string{"descendant_id"}},
+		},
+	}
+
+	mg.AddMigration("create tag_edge table", NewAddTableMigration(tagEdgeV1))
+	mg.AddMigration("add unique index tag_edge.ancestor_id_descendant_id", NewAddIndexMigration(tagEdgeV1, tagEdgeV1.Indices[0]))
+	mg.AddMigration("add index tag_edge.descendant_id", NewAddIndexMigration(tagEdgeV1, tagEdgeV1.Indices[1]))
+}
@@ -0,0 +1,42 @@
+package tag
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrConflictingParent = errors.New("tag already exists under a different parent")
+	ErrParentNotFound    = errors.New("parent tag does not exist")
+	ErrHasDescendants    = errors.New("tag has descendants and cannot be deleted")
+)
+
+// Tag is a key, or key:value pair, optionally namespaced under a parent tag
+// (e.g. "env/prod" declares "env" as its parent). Parent is the parent's Id,
+// or 0 for a top-level tag.
+type Tag struct {
+	Id     int64
+	Key    string
+	Value  string
+	Parent int64
+}
+
+// Service is the interface for the tag service.
+type Service interface {
+	// EnsureTagsExist creates any of tags that don't already exist and
+	// resolves the rest to their existing row, failing with
+	// ErrConflictingParent if a tag gives a non-zero Parent that differs
+	// from the existing row's parent; a zero Parent resolves to the existing
+	// row whatever its parent. There
+	// is no cycle to reject here: a tag's parent must already exist
+	// (ErrParentNotFound) and, once set, is never changed by a later call,
+	// so no sequence of EnsureTagsExist calls can link a tag back to one of
+	// its own descendants.
+	EnsureTagsExist(ctx context.Context, tags []*Tag) ([]*Tag, error)
+	ResolveAncestors(ctx context.Context, tagIDs []int64) ([]*Tag, error)
+	ResolveDescendants(ctx context.Context, tagIDs []int64) ([]*Tag, error)
+	// DeleteTag removes a tag and its closure-table edges. It fails with
+	// ErrHasDescendants if the tag is still a parent of any other tag, so a
+	// subtree can't be orphaned by deleting out from under it.
+	DeleteTag(ctx context.Context, id int64) error
+}
@@ -0,0 +1,22 @@
+package tagimpl
+
+import (
+	"context"
+
+	"github.com/grafana/grafana/pkg/services/tag"
+)
+
+// store is the storage interface backing the tag service.
+type store interface {
+	EnsureTagsExist(ctx context.Context, tags []*tag.Tag) ([]*tag.Tag, error)
+	// ResolveAncestors returns every tag that is a parent, grandparent, etc.
+	// of the given tags, using the tag_edge transitive-closure cache so the
+	// lookup is O(1) per tag regardless of hierarchy depth.
+	ResolveAncestors(ctx context.Context, tagIDs []int64) ([]*tag.Tag, error)
+	// ResolveDescendants returns every tag that is a child, grandchild, etc.
+	// of the given tags.
+	ResolveDescendants(ctx context.Context, tagIDs []int64) ([]*tag.Tag, error)
+	// DeleteTag removes a tag and its tag_edge rows. It returns
+	// tag.ErrHasDescendants if the tag is still a parent of another tag.
+	DeleteTag(ctx context.Context, id int64) error
+}
@@ -29,3 +29,95 @@ func testIntegrationSavingTags(t *testing.T, fn getStore) {
 	require.Nil(t, err)
 	require.Equal(t, 4, len(tags))
 }
+
+func testIntegrationTagHierarchies(t *testing.T, fn getStore) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	t.Run("Resolving ancestors and descendants across multiple levels", func(t *testing.T) {
+		ss := db.InitTestDB(t)
+		store := fn(ss)
+
+		envTags, err := store.EnsureTagsExist(context.Background(), []*tag.Tag{{Key: "env"}})
+		require.NoError(t, err)
+		env := envTags[0]
+
+		prodTags, err := store.EnsureTagsExist(context.Background(), []*tag.Tag{{Key: "env", Value: "prod", Parent: env.Id}})
+		require.NoError(t, err)
+		prod := prodTags[0]
+
+		usEastTags, err := store.EnsureTagsExist(context.Background(), []*tag.Tag{{Key: "region", Value: "us-east", Parent: prod.Id}})
+		require.NoError(t, err)
+		usEast := usEastTags[0]
+
+		ancestors, err := store.ResolveAncestors(context.Background(), []int64{usEast.Id})
+		require.NoError(t, err)
+		require.Len(t, ancestors, 2)
+
+		descendants, err := store.ResolveDescendants(context.Background(), []int64{env.Id})
+		require.NoError(t, err)
+		require.Len(t, descendants, 2)
+	})
+
+	t.Run("A parent reference to a non-existent tag is rejected", func(t *testing.T) {
+		ss := db.InitTestDB(t)
+		store := fn(ss)
+
+		_, err := store.EnsureTagsExist(context.Background(), []*tag.Tag{{Key: "env", Value: "prod", Parent: 999999}})
+		require.ErrorIs(t, err, tag.ErrParentNotFound)
+	})
+
+	t.Run("Re-declaring an existing tag under a different parent is rejected", func(t *testing.T) {
+		ss := db.InitTestDB(t)
+		store := fn(ss)
+
+		parents, err := store.EnsureTagsExist(context.Background(), []*tag.Tag{{Key: "env"}, {Key: "team"}})
+		require.NoError(t, err)
+		envParent, teamParent := parents[0], parents[1]
+
+		_, err = store.EnsureTagsExist(context.Background(), []*tag.Tag{{Key: "env", Value: "prod", Parent: envParent.Id}})
+		require.NoError(t, err)
+
+		_, err = store.EnsureTagsExist(context.Background(), []*tag.Tag{{Key: "env", Value: "prod", Parent: teamParent.Id}})
+		require.ErrorIs(t, err, tag.ErrConflictingParent)
+	})
+
+	t.Run("Closure table stays consistent after deleting a leaf tag", func(t *testing.T) {
+		ss := db.InitTestDB(t)
+		store := fn(ss)
+
+		envTags, err := store.EnsureTagsExist(context.Background(), []*tag.Tag{{Key: "env"}})
+		require.NoError(t, err)
+		env := envTags[0]
+
+		prodTags, err := store.EnsureTagsExist(context.Background(), []*tag.Tag{{Key: "env", Value: "prod", Parent: env.Id}})
+		require.NoError(t, err)
+		prod := prodTags[0]
+
+		require.NoError(t, store.DeleteTag(context.Background(), prod.Id))
+
+		descendants, err := store.ResolveDescendants(context.Background(), []int64{env.Id})
+		require.NoError(t, err)
+		require.Len(t, descendants, 0)
+	})
+
+	t.Run("Deleting a tag that still has descendants is rejected", func(t *testing.T) {
+		ss := db.InitTestDB(t)
+		store := fn(ss)
+
+		envTags, err := store.EnsureTagsExist(context.Background(), []*tag.Tag{{Key: "env"}})
+		require.NoError(t, err)
+		env := envTags[0]
+
+		_, err = store.EnsureTagsExist(context.Background(), []*tag.Tag{{Key: "env", Value: "prod", Parent: env.Id}})
+		require.NoError(t, err)
+
+		err = store.DeleteTag(context.Background(), env.Id)
+		require.ErrorIs(t, err, tag.ErrHasDescendants)
+
+		descendants, err := store.ResolveDescendants(context.Background(), []int64{env.Id})
+		require.NoError(t, err)
+		require.Len(t, descendants, 1)
+	})
+}
@@ -0,0 +1,32 @@
+package tagimpl
+
+import (
+	"context"
+
+	"github.com/grafana/grafana/pkg/infra/db"
+	"github.com/grafana/grafana/pkg/services/tag"
+)
+
+type Service struct {
+	store store
+}
+
+func ProvideService(db db.DB) tag.Service {
+	return &Service{store: &sqlStore{db: db}}
+}
+
+func (s *Service) EnsureTagsExist(ctx context.Context, tags []*tag.Tag) ([]*tag.Tag, error) {
+	return s.store.EnsureTagsExist(ctx, tags)
+}
+
+func (s *Service) ResolveAncestors(ctx context.Context, tagIDs []int64) ([]*tag.Tag, error) {
+	return s.store.ResolveAncestors(ctx, tagIDs)
+}
+
+func (s *Service) ResolveDescendants(ctx context.Context, tagIDs []int64) ([]*tag.Tag, error) {
+	return s.store.ResolveDescendants(ctx, tagIDs)
+}
+
+func (s *Service) DeleteTag(ctx context.Context, id int64) error {
+	return s.store.DeleteTag(ctx, id)
+}
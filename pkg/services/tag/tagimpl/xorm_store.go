@@ -0,0 +1,161 @@
+package tagimpl
+
+import (
+	"context"
+
+	"github.com/grafana/grafana/pkg/infra/db"
+	"github.com/grafana/grafana/pkg/services/tag"
+)
+
+type sqlStore struct {
+	db db.DB
+}
+
+// tagEdge is a row in the tag_edge transitive-closure cache: it records
+// that ancestorId is an ancestor of descendantId, depth levels up. A tag is
+// always its own ancestor at depth 0, which makes ancestor/descendant
+// lookups a single indexed query instead of a recursive walk.
+type tagEdge struct {
+	Id           int64
+	AncestorId   int64
+	DescendantId int64
+	Depth        int
+}
+
+func (tagEdge) TableName() string {
+	return "tag_edge"
+}
+
+func (s *sqlStore) EnsureTagsExist(ctx context.Context, tags []*tag.Tag) ([]*tag.Tag, error) {
+	err := s.db.WithTransactionalDbSession(ctx, func(sess *db.Session) error {
+		for _, t := range tags {
+			existing := tag.Tag{}
+			has, err := sess.Table("tag").Where("tag.key=? AND tag.value=?", t.Key, t.Value).Get(&existing)
+			if err != nil {
+				return err
+			}
+
+			if has {
+				if t.Parent != 0 && t.Parent != existing.Parent {
+					return tag.ErrConflictingParent
+				}
+				*t = existing
+				continue
+			}
+
+			if t.Parent != 0 {
+				if err := s.checkParentExists(sess, t.Parent); err != nil {
+					return err
+				}
+			}
+
+			if _, err := sess.Insert(t); err != nil {
+				return err
+			}
+
+			if err := s.insertClosureEdges(sess, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func (s *sqlStore) checkParentExists(sess *db.Session, parentID int64) error {
+	has, err := sess.Table("tag").Where("id=?", parentID).Exist()
+	if err != nil {
+		return err
+	}
+	if !has {
+		return tag.ErrParentNotFound
+	}
+	return nil
+}
+
+// insertClosureEdges populates the tag_edge cache for a newly created tag:
+// a self edge at depth 0, and one edge per ancestor of its parent, each one
+// level deeper than the parent's own edge to that ancestor. A new tag can
+// never introduce a cycle: checkParentExists already requires its parent to
+// be a pre-existing tag, and EnsureTagsExist refuses to re-parent an
+// existing tag (ErrConflictingParent), so there is no path that links a tag
+// back to one of its own not-yet-created descendants.
+func (s *sqlStore) insertClosureEdges(sess *db.Session, t *tag.Tag) error {
+	if _, err := sess.Insert(&tagEdge{AncestorId: t.Id, DescendantId: t.Id, Depth: 0}); err != nil {
+		return err
+	}
+
+	if t.Parent == 0 {
+		return nil
+	}
+
+	var parentAncestors []tagEdge
+	if err := sess.Table("tag_edge").Where("descendant_id=?", t.Parent).Find(&parentAncestors); err != nil {
+		return err
+	}
+
+	for _, edge := range parentAncestors {
+		if _, err := sess.Insert(&tagEdge{AncestorId: edge.AncestorId, DescendantId: t.Id, Depth: edge.Depth + 1}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteTag removes a tag and its tag_edge rows. It refuses to delete a tag
+// that is still an ancestor of another tag (other than itself), since doing
+// so would silently detach that subtree from the hierarchy instead of
+// requiring the caller to delete or re-parent it explicitly.
+func (s *sqlStore) DeleteTag(ctx context.Context, id int64) error {
+	return s.db.WithTransactionalDbSession(ctx, func(sess *db.Session) error {
+		hasDescendants, err := sess.Table("tag_edge").Where("ancestor_id=? AND descendant_id!=?", id, id).Exist()
+		if err != nil {
+			return err
+		}
+		if hasDescendants {
+			return tag.ErrHasDescendants
+		}
+
+		if _, err := sess.Exec("DELETE FROM tag_edge WHERE ancestor_id=? OR descendant_id=?", id, id); err != nil {
+			return err
+		}
+		_, err = sess.Exec("DELETE FROM tag WHERE id=?", id)
+		return err
+	})
+}
+
+func (s *sqlStore) ResolveAncestors(ctx context.Context, tagIDs []int64) ([]*tag.Tag, error) {
+	if len(tagIDs) == 0 {
+		return nil, nil
+	}
+	var result []*tag.Tag
+	err := s.db.WithDbSession(ctx, func(sess *db.Session) error {
+		return sess.Table("tag_edge").
+			Join("INNER", "tag", "tag.id = tag_edge.ancestor_id").
+			In("tag_edge.descendant_id", tagIDs).
+			And("tag_edge.ancestor_id != tag_edge.descendant_id").
+			Distinct("tag.id", "tag.key", "tag.value", "tag.parent").
+			Find(&result)
+	})
+	return result, err
+}
+
+func (s *sqlStore) ResolveDescendants(ctx context.Context, tagIDs []int64) ([]*tag.Tag, error) {
+	if len(tagIDs) == 0 {
+		return nil, nil
+	}
+	var result []*tag.Tag
+	err := s.db.WithDbSession(ctx, func(sess *db.Session) error {
+		return sess.Table("tag_edge").
+			Join("INNER", "tag", "tag.id = tag_edge.descendant_id").
+			In("tag_edge.ancestor_id", tagIDs).
+			And("tag_edge.ancestor_id != tag_edge.descendant_id").
+			Distinct("tag.id", "tag.key", "tag.value", "tag.parent").
+			Find(&result)
+	})
+	return result, err
+}
@@ -0,0 +1,19 @@
+package tagimpl
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/infra/db"
+)
+
+func TestIntegrationXORMTagDataAccess(t *testing.T) {
+	testIntegrationSavingTags(t, func(ss db.DB) store {
+		return &sqlStore{db: ss}
+	})
+}
+
+func TestIntegrationXORMTagHierarchies(t *testing.T) {
+	testIntegrationTagHierarchies(t, func(ss db.DB) store {
+		return &sqlStore{db: ss}
+	})
+}